@@ -0,0 +1,238 @@
+// Package k8sagent watches the Kubernetes API for the set of pods
+// podtailer.PodSetTailer should be collecting logs from.
+package k8sagent
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/pkg/api/v1"
+	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/types"
+	"k8s.io/client-go/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	toolswatch "k8s.io/client-go/tools/watch"
+
+	"github.com/Sirupsen/logrus"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const podWatcherRelistBackoff = 1 * time.Second
+
+// PodGetter is satisfied by PodWatcher so that consumers (e.g.
+// processors.KubernetesMetadataProcessor) can look up a pod's current
+// metadata by UID without keeping their own cache.
+type PodGetter interface {
+	GetPodForUID(uid types.UID) (*v1.Pod, bool)
+}
+
+// PodWatcher watches a namespace, optionally scoped by labelSelector and
+// node, for pod add/delete events.
+type PodWatcher interface {
+	PodGetter
+	Pods() <-chan *v1.Pod
+	DeletedPods() <-chan types.UID
+	Stop()
+}
+
+// podWatcher is a PodWatcher backed by a client-go RetryWatcher. It seeds
+// itself with a List to get a starting resourceVersion, then watches with
+// AllowWatchBookmarks so the server periodically advances that cursor even
+// when nothing else changes. The RetryWatcher itself reconnects through
+// ordinary connection drops; on a StatusReasonGone error (the
+// resourceVersion aged out of the API server's watch cache) podWatcher
+// relists from scratch and reconciles its pod cache against the fresh
+// list, emitting Pods()/DeletedPods() events only for the UIDs that
+// actually appeared or disappeared so callers don't redo work for pods
+// that were there the whole time.
+type podWatcher struct {
+	namespace     string
+	labelSelector string
+	fieldSelector string
+	client        corev1.PodsGetter
+
+	pods        chan *v1.Pod
+	deletedPods chan types.UID
+
+	mu    sync.RWMutex
+	cache map[types.UID]*v1.Pod
+
+	stop chan struct{}
+}
+
+// NewPodWatcher starts watching namespace for pods matching labelSelector
+// (and, if non-empty, fieldSelector, typically used to scope to a single
+// node) and returns immediately; events are delivered asynchronously on the
+// returned PodWatcher's channels.
+func NewPodWatcher(namespace, labelSelector, fieldSelector string, client corev1.PodsGetter) PodWatcher {
+	pw := &podWatcher{
+		namespace:     namespace,
+		labelSelector: labelSelector,
+		fieldSelector: fieldSelector,
+		client:        client,
+		pods:          make(chan *v1.Pod),
+		deletedPods:   make(chan types.UID),
+		cache:         make(map[types.UID]*v1.Pod),
+		stop:          make(chan struct{}),
+	}
+	go pw.run()
+	return pw
+}
+
+func (pw *podWatcher) Pods() <-chan *v1.Pod          { return pw.pods }
+func (pw *podWatcher) DeletedPods() <-chan types.UID { return pw.deletedPods }
+
+func (pw *podWatcher) GetPodForUID(uid types.UID) (*v1.Pod, bool) {
+	pw.mu.RLock()
+	defer pw.mu.RUnlock()
+	pod, ok := pw.cache[uid]
+	return pod, ok
+}
+
+func (pw *podWatcher) Stop() {
+	close(pw.stop)
+}
+
+func (pw *podWatcher) run() {
+	for {
+		resourceVersion, err := pw.relist()
+		if err != nil {
+			logrus.WithError(err).Error("Error listing pods, retrying")
+			if !pw.sleepOrStop(podWatcherRelistBackoff) {
+				return
+			}
+			continue
+		}
+
+		rw, err := toolswatch.NewRetryWatcher(resourceVersion, &cache.ListWatch{
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = pw.labelSelector
+				options.FieldSelector = pw.fieldSelector
+				options.AllowWatchBookmarks = true
+				return pw.client.Pods(pw.namespace).Watch(options)
+			},
+		})
+		if err != nil {
+			logrus.WithError(err).Error("Error creating pod retry watcher, retrying")
+			if !pw.sleepOrStop(podWatcherRelistBackoff) {
+				return
+			}
+			continue
+		}
+
+		gone := pw.consume(rw)
+		rw.Stop()
+		if !gone {
+			// pw.stop was closed.
+			return
+		}
+		// The watch reported an error (e.g. StatusReasonGone) or its
+		// channel closed; loop around to relist and start a fresh watch.
+	}
+}
+
+// consume reads events off the retry watcher until it's told to relist
+// (StatusReasonGone), the channel closes, or pw.stop fires. It returns false
+// only when pw.stop fires; in the other two cases it returns true so run()
+// relists and starts a fresh watch.
+func (pw *podWatcher) consume(rw *toolswatch.RetryWatcher) bool {
+	for {
+		select {
+		case <-pw.stop:
+			return false
+		case event, ok := <-rw.ResultChan():
+			if !ok {
+				return true
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				pod, ok := event.Object.(*v1.Pod)
+				if !ok {
+					continue
+				}
+				pw.addOrUpdate(pod)
+			case watch.Deleted:
+				pod, ok := event.Object.(*v1.Pod)
+				if !ok {
+					continue
+				}
+				pw.remove(pod.UID)
+			case watch.Bookmark:
+				// Nothing to do; RetryWatcher already advanced its cursor.
+			case watch.Error:
+				return true
+			}
+		}
+	}
+}
+
+// relist lists the current matching pods, reconciles pw.cache against
+// them (emitting Pods()/DeletedPods() only for what actually changed), and
+// returns the list's resourceVersion to seed the next watch.
+func (pw *podWatcher) relist() (string, error) {
+	list, err := pw.client.Pods(pw.namespace).List(metav1.ListOptions{
+		LabelSelector: pw.labelSelector,
+		FieldSelector: pw.fieldSelector,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	seen := make(map[types.UID]bool, len(list.Items))
+	for i := range list.Items {
+		pod := &list.Items[i]
+		seen[pod.UID] = true
+		pw.addOrUpdate(pod)
+	}
+
+	pw.mu.RLock()
+	var stale []types.UID
+	for uid := range pw.cache {
+		if !seen[uid] {
+			stale = append(stale, uid)
+		}
+	}
+	pw.mu.RUnlock()
+	for _, uid := range stale {
+		pw.remove(uid)
+	}
+
+	return list.ResourceVersion, nil
+}
+
+func (pw *podWatcher) addOrUpdate(pod *v1.Pod) {
+	pw.mu.Lock()
+	_, existed := pw.cache[pod.UID]
+	pw.cache[pod.UID] = pod
+	pw.mu.Unlock()
+
+	if !existed {
+		select {
+		case pw.pods <- pod:
+		case <-pw.stop:
+		}
+	}
+}
+
+func (pw *podWatcher) remove(uid types.UID) {
+	pw.mu.Lock()
+	_, existed := pw.cache[uid]
+	delete(pw.cache, uid)
+	pw.mu.Unlock()
+
+	if existed {
+		select {
+		case pw.deletedPods <- uid:
+		case <-pw.stop:
+		}
+	}
+}
+
+func (pw *podWatcher) sleepOrStop(d time.Duration) bool {
+	select {
+	case <-pw.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,247 @@
+package podtailer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/pkg/api/v1"
+	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/honeycombio/honeycomb-kubernetes-agent/handlers"
+	"github.com/honeycombio/honeycomb-kubernetes-agent/tailer"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	apiLogSourceInitialBackoff = 1 * time.Second
+	apiLogSourceMaxBackoff     = 30 * time.Second
+)
+
+// apiPodLogSource streams a pod's container logs directly from the API
+// server (PodInterface.GetLogs), instead of tailing files under /var/log.
+// It runs one goroutine per container, reconnecting with backoff whenever
+// a stream ends while the pod is still Running, and checkpoints the
+// timestamp of the last line it saw so a restart resumes via SinceTime
+// rather than replaying the whole log.
+type apiPodLogSource struct {
+	pod            *v1.Pod
+	containers     []string
+	podsGetter     corev1.PodsGetter
+	handlerFactory handlers.LineHandlerFactory
+	stateRecorder  tailer.StateRecorder
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newAPIPodLogSource(
+	pod *v1.Pod,
+	containers []string,
+	podsGetter corev1.PodsGetter,
+	handlerFactory handlers.LineHandlerFactory,
+	stateRecorder tailer.StateRecorder,
+) *apiPodLogSource {
+	return &apiPodLogSource{
+		pod:            pod,
+		containers:     containers,
+		podsGetter:     podsGetter,
+		handlerFactory: handlerFactory,
+		stateRecorder:  stateRecorder,
+		stop:           make(chan struct{}),
+	}
+}
+
+func (s *apiPodLogSource) Start() {
+	for _, container := range s.containers {
+		s.wg.Add(1)
+		go s.streamContainer(container)
+	}
+}
+
+func (s *apiPodLogSource) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// stateKey identifies this pod/container pair in the shared StateRecorder,
+// the same way the file tailer keys its offsets by path.
+func (s *apiPodLogSource) stateKey(container string) string {
+	return fmt.Sprintf("api:%s:%s", s.pod.UID, container)
+}
+
+// streamContainer owns the reconnect loop for a single container: open a
+// GetLogs stream starting from wherever we last checkpointed, read lines
+// until the stream ends, and reconnect with backoff unless Stop was called.
+func (s *apiPodLogSource) streamContainer(container string) {
+	defer s.wg.Done()
+
+	backoff := apiLogSourceInitialBackoff
+	handler := s.handlerFactory.New()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		if s.containerDone(container) {
+			logrus.WithFields(logrus.Fields{
+				"pod":       s.pod.Name,
+				"uid":       s.pod.UID,
+				"container": container,
+			}).Info("container is no longer running, stopping API log stream")
+			return
+		}
+
+		opts := &v1.PodLogOptions{
+			Container:  container,
+			Follow:     true,
+			Timestamps: true,
+			SinceTime:  s.lastCheckpoint(container),
+		}
+
+		stream, err := s.podsGetter.Pods(s.pod.Namespace).GetLogs(s.pod.Name, opts).Stream()
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"pod":       s.pod.Name,
+				"uid":       s.pod.UID,
+				"container": container,
+			}).Warn("Error opening API log stream, retrying")
+			if !s.sleepOrStop(backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+
+		// A successful connection resets the backoff.
+		backoff = apiLogSourceInitialBackoff
+		lastTimestamp, streamErr := s.consume(stream, handler)
+		stream.Close()
+		if lastTimestamp != nil {
+			s.checkpoint(container, *lastTimestamp)
+		}
+		if streamErr != nil && streamErr != io.EOF {
+			logrus.WithError(streamErr).WithFields(logrus.Fields{
+				"pod":       s.pod.Name,
+				"uid":       s.pod.UID,
+				"container": container,
+			}).Warn("API log stream ended with error, reconnecting")
+		}
+
+		if !s.sleepOrStop(backoff) {
+			return
+		}
+	}
+}
+
+// consume reads lines from an open log stream until it ends or Stop is
+// called, handing each one to the shared handler pipeline. Kubelet
+// prefixes each line with an RFC3339Nano timestamp (because we asked for
+// Timestamps: true); consume strips it off before handing the line to the
+// handler and returns it so the caller can checkpoint progress.
+func (s *apiPodLogSource) consume(stream io.ReadCloser, handler handlers.LineHandler) (*time.Time, error) {
+	scanner := bufio.NewScanner(stream)
+	var lastTimestamp *time.Time
+
+	for scanner.Scan() {
+		select {
+		case <-s.stop:
+			return lastTimestamp, nil
+		default:
+		}
+
+		ts, rest := splitTimestamp(scanner.Text())
+		if ts != nil {
+			lastTimestamp = ts
+		}
+		handler.Handle(rest)
+	}
+	return lastTimestamp, scanner.Err()
+}
+
+// splitTimestamp splits a kubelet log line of the form
+// "<RFC3339Nano timestamp> <line>" into its timestamp and remainder. If the
+// line doesn't start with a parseable timestamp, it's returned unmodified
+// with a nil timestamp.
+func splitTimestamp(line string) (*time.Time, string) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 {
+		return nil, line
+	}
+	ts, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, line
+	}
+	return &ts, parts[1]
+}
+
+// containerDone reports whether container has stopped producing new logs
+// for good: the pod as a whole has reached a terminal phase, or the
+// container itself has terminated and isn't waiting to restart. It re-fetches
+// the pod rather than trusting s.pod, which is a point-in-time snapshot from
+// whenever the watcher was set up. A Get error (e.g. the pod was deleted out
+// from under us) is left for the next GetLogs call to fail on instead of
+// guessed at here.
+func (s *apiPodLogSource) containerDone(container string) bool {
+	pod, err := s.podsGetter.Pods(s.pod.Namespace).Get(s.pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return true
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == container {
+			return cs.State.Terminated != nil && cs.State.Waiting == nil
+		}
+	}
+	return false
+}
+
+func (s *apiPodLogSource) checkpoint(container string, ts time.Time) {
+	if err := s.stateRecorder.Record(s.stateKey(container), ts.Format(time.RFC3339Nano)); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"pod":       s.pod.Name,
+			"container": container,
+		}).Warn("Error checkpointing API log source state")
+	}
+}
+
+func (s *apiPodLogSource) lastCheckpoint(container string) *metav1.Time {
+	raw, err := s.stateRecorder.Get(s.stateKey(container))
+	if err != nil || raw == "" {
+		return nil
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return nil
+	}
+	// SinceTime is an inclusive lower bound, so passing the checkpoint
+	// unchanged would redeliver the very last line we already handled on
+	// every reconnect. Nudge it forward a nanosecond past that line instead.
+	return &metav1.Time{Time: parsed.Add(time.Nanosecond)}
+}
+
+func nextBackoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > apiLogSourceMaxBackoff {
+		return apiLogSourceMaxBackoff
+	}
+	return d
+}
+
+func (s *apiPodLogSource) sleepOrStop(d time.Duration) bool {
+	select {
+	case <-s.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
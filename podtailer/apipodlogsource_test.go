@@ -0,0 +1,25 @@
+package podtailer
+
+import "testing"
+
+func TestSplitTimestamp(t *testing.T) {
+	line := "2026-07-29T12:00:00.123456789Z hello world"
+	ts, rest := splitTimestamp(line)
+	if ts == nil {
+		t.Fatal("splitTimestamp() returned nil timestamp for a valid RFC3339Nano-prefixed line")
+	}
+	if rest != "hello world" {
+		t.Errorf("splitTimestamp() rest = %q, want %q", rest, "hello world")
+	}
+}
+
+func TestSplitTimestampNoTimestamp(t *testing.T) {
+	line := "not a timestamp at all"
+	ts, rest := splitTimestamp(line)
+	if ts != nil {
+		t.Errorf("splitTimestamp() timestamp = %v, want nil", ts)
+	}
+	if rest != line {
+		t.Errorf("splitTimestamp() rest = %q, want %q", rest, line)
+	}
+}
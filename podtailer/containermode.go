@@ -0,0 +1,86 @@
+package podtailer
+
+import (
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	containerModeAll = "all"
+	containerModeApp = "app"
+
+	// knativeUserContainer is the name Knative always gives the container
+	// it injected from the user's image, regardless of sidecars.
+	knativeUserContainer = "user-container"
+)
+
+// defaultSidecarNames are the injected sidecars config.ContainerMode "app"
+// knows to skip out of the box. config.WatcherConfig.SidecarNames extends
+// this list for meshes/sidecars we don't already know about.
+var defaultSidecarNames = map[string]bool{
+	"istio-proxy":   true,
+	"queue-proxy":   true,
+	"linkerd-proxy": true,
+	"envoy":         true,
+	"vault-agent":   true,
+}
+
+// resolveContainerName applies config.ContainerMode to pick which
+// container's logs to collect for pod. An explicit containerName (from
+// config.ContainerName) always wins; "all" (the default) keeps the
+// historical behavior of tailing every container; "app" tries to skip
+// known sidecars so they don't drown out the application's own logs.
+func (pt *PodSetTailer) resolveContainerName(pod *v1.Pod, containerName string) string {
+	if containerName != "" {
+		return containerName
+	}
+	if pt.config.ContainerMode != containerModeApp {
+		return ""
+	}
+
+	chosen := appContainerName(pod, pt.sidecarNames())
+	logrus.WithFields(logrus.Fields{
+		"pod":       pod.Name,
+		"uid":       pod.UID,
+		"container": chosen,
+	}).Info("Auto-detected application container")
+	return chosen
+}
+
+// sidecarNames merges defaultSidecarNames with any names the user added via
+// config.WatcherConfig.SidecarNames.
+func (pt *PodSetTailer) sidecarNames() map[string]bool {
+	if len(pt.config.SidecarNames) == 0 {
+		return defaultSidecarNames
+	}
+	sidecars := make(map[string]bool, len(defaultSidecarNames)+len(pt.config.SidecarNames))
+	for name := range defaultSidecarNames {
+		sidecars[name] = true
+	}
+	for _, name := range pt.config.SidecarNames {
+		sidecars[name] = true
+	}
+	return sidecars
+}
+
+// appContainerName picks the container that's most likely "the app" out of
+// a pod with sidecars injected: the Knative user-container convention if
+// present, else the first container that isn't a known sidecar, else
+// falls back to the pod's first container.
+func appContainerName(pod *v1.Pod, sidecars map[string]bool) string {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == knativeUserContainer {
+			return c.Name
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		if !sidecars[c.Name] {
+			return c.Name
+		}
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package podtailer
+
+import (
+	"testing"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func containerPod(names ...string) *v1.Pod {
+	pod := &v1.Pod{}
+	for _, name := range names {
+		pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: name})
+	}
+	return pod
+}
+
+func TestAppContainerNamePrefersKnativeUserContainer(t *testing.T) {
+	pod := containerPod("istio-proxy", knativeUserContainer)
+	if got := appContainerName(pod, defaultSidecarNames); got != knativeUserContainer {
+		t.Errorf("appContainerName() = %q, want %q", got, knativeUserContainer)
+	}
+}
+
+func TestAppContainerNameSkipsKnownSidecars(t *testing.T) {
+	pod := containerPod("istio-proxy", "app")
+	if got := appContainerName(pod, defaultSidecarNames); got != "app" {
+		t.Errorf("appContainerName() = %q, want %q", got, "app")
+	}
+}
+
+func TestAppContainerNameFallsBackToFirstContainer(t *testing.T) {
+	pod := containerPod("istio-proxy", "queue-proxy")
+	if got := appContainerName(pod, defaultSidecarNames); got != "istio-proxy" {
+		t.Errorf("appContainerName() = %q, want %q", got, "istio-proxy")
+	}
+}
+
+func TestAppContainerNameNoContainers(t *testing.T) {
+	pod := containerPod()
+	if got := appContainerName(pod, defaultSidecarNames); got != "" {
+		t.Errorf("appContainerName() = %q, want empty string", got)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"k8s.io/client-go/pkg/api/v1"
+	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
 	"k8s.io/client-go/pkg/types"
 
 	"github.com/Sirupsen/logrus"
@@ -19,9 +20,26 @@ import (
 	"github.com/honeycombio/honeycomb-kubernetes-agent/tailer"
 	"github.com/honeycombio/honeycomb-kubernetes-agent/transmission"
 	"github.com/honeycombio/honeycomb-kubernetes-agent/unwrappers"
+	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
+// logSourceAPI selects streaming container logs from the Kubernetes API
+// server (PodInterface.GetLogs) instead of tailing files under /var/log.
+// It's the value expected in config.WatcherConfig.LogSource; anything else,
+// including the empty string, keeps the historical file-tailing behavior.
+const logSourceAPI = "api"
+
+// podLogSource is satisfied by both ways PodSetTailer can collect a single
+// pod's container logs: tailing files under /var/log (a tailer.PathWatcher,
+// or a retryingFileLogSource while the log path can't be resolved yet; see
+// fileLogSourceForPod) or streaming them from the API server
+// (apiPodLogSource). watcherForPod picks one based on config.LogSource.
+type podLogSource interface {
+	Start()
+	Stop()
+}
+
 // PodSetTailer is responsible for watching for all pods that match the
 // criteria defined by config, and managing tailers for each pod.
 type PodSetTailer struct {
@@ -30,7 +48,9 @@ type PodSetTailer struct {
 	transmitter    transmission.Transmitter
 	stateRecorder  tailer.StateRecorder
 	kubeClient     corev1.PodsGetter
+	appsClient     appsv1.AppsV1Interface
 	stop           chan bool
+	workloadStop   chan struct{}
 	wg             sync.WaitGroup
 	legacyLogPaths bool
 }
@@ -41,27 +61,32 @@ func NewPodSetTailer(
 	transmitter transmission.Transmitter,
 	stateRecorder tailer.StateRecorder,
 	kubeClient corev1.PodsGetter,
+	appsClient appsv1.AppsV1Interface,
 	legacyLogPaths bool,
-) *PodSetTailer {
+) (*PodSetTailer, error) {
+	if config.LabelSelector != nil && *config.LabelSelector != "" && config.Workload != nil {
+		return nil, fmt.Errorf("config error: labelSelector and workload are mutually exclusive")
+	}
 	return &PodSetTailer{
 		config:         config,
 		nodeSelector:   nodeSelector,
 		transmitter:    transmitter,
 		stateRecorder:  stateRecorder,
 		kubeClient:     kubeClient,
+		appsClient:     appsClient,
 		stop:           make(chan bool),
+		workloadStop:   make(chan struct{}),
 		legacyLogPaths: legacyLogPaths,
-	}
+	}, nil
 }
 
 func (pt *PodSetTailer) run() {
 	defer pt.wg.Done()
-	labelSelector := *pt.config.LabelSelector
-	// Exclude the agent's own logs from being watched
-	if labelSelector == "" {
-		labelSelector = "k8s-app!=honeycomb-agent"
-	} else {
-		labelSelector = labelSelector + ",k8s-app!=honeycomb-agent"
+
+	labelSelector, err := pt.resolveLabelSelector()
+	if err != nil {
+		logrus.WithError(err).Error("Error resolving pod selector")
+		return
 	}
 
 	podWatcher := k8sagent.NewPodWatcher(
@@ -70,13 +95,29 @@ func (pt *PodSetTailer) run() {
 		pt.nodeSelector,
 		pt.kubeClient)
 
-	watcherMap := make(map[types.UID]*tailer.PathWatcher)
+	var selectorUpdates <-chan string
+	if pt.config.Workload != nil {
+		if kind, _ := normalizeWorkloadKind(pt.config.Workload.Kind); kind == "Deployment" {
+			selectorUpdates = watchDeploymentSelector(pt.appsClient, pt.config.Namespace, pt.config.Workload.Name, pt.workloadStop)
+		}
+	}
+
+	watcherMap := make(map[types.UID]podLogSource)
+	streamErrors := make(chan tailer.StreamError)
 
 loop:
 	for {
 		select {
 		case pod := <-podWatcher.Pods():
-			watcher, err := pt.watcherForPod(pod, pt.config.ContainerName, podWatcher)
+			if _, ok := watcherMap[pod.UID]; ok {
+				// Already have a live watcher for this pod — this fires
+				// whenever podWatcher is replaced (e.g. on a workload
+				// selector change) and its relist re-announces every pod
+				// it already matched. Leave the existing watcher alone so
+				// we don't rotate file offsets or double-ship its lines.
+				continue loop
+			}
+			watcher, err := pt.watcherForPod(pod, pt.config.ContainerName, podWatcher, streamErrors)
 			if err != nil {
 				// This shouldn't happen, since we check for configuration errors
 				// before actually setting up the watcher
@@ -98,6 +139,27 @@ loop:
 				watcher.Stop()
 				delete(watcherMap, deletedPodUID)
 			}
+		case streamErr := <-streamErrors:
+			pt.handleStreamError(streamErr, watcherMap)
+		case newSelector, ok := <-selectorUpdates:
+			if !ok {
+				selectorUpdates = nil
+				continue loop
+			}
+			if newSelector != labelSelector {
+				logrus.WithFields(logrus.Fields{
+					"old": labelSelector,
+					"new": newSelector,
+				}).Info("workload selector changed, restarting pod watcher")
+				labelSelector = newSelector
+				podWatcher.Stop()
+				podWatcher = k8sagent.NewPodWatcher(
+					pt.config.Namespace,
+					labelSelector,
+					pt.nodeSelector,
+					pt.kubeClient)
+				pt.reconcileWatcherMap(labelSelector, watcherMap)
+			}
 		case <-pt.stop:
 			break loop
 		}
@@ -108,12 +170,106 @@ loop:
 	}
 }
 
+// handleStreamError reacts to a tailer.StreamError surfaced by one of
+// watcherMap's podLogSources. Recoverable errors (a log file not yet
+// created, a short read during rotation) are just logged — the source
+// itself keeps retrying. Non-recoverable errors mean there's nothing left
+// to watch for that pod, so the watcher is torn down and removed from
+// watcherMap. No fresh watcher is started for that pod while it stays in
+// podWatcher's cache, since Pods() only announces UIDs it hasn't seen.
+func (pt *PodSetTailer) handleStreamError(streamErr tailer.StreamError, watcherMap map[types.UID]podLogSource) {
+	log := logrus.WithFields(logrus.Fields{
+		"uid":       streamErr.PodUID,
+		"container": streamErr.ContainerName,
+	}).WithError(streamErr.Err)
+
+	if streamErr.Recoverable {
+		log.Warn("Recoverable error tailing pod logs, retrying")
+		return
+	}
+
+	log.Warn("Non-recoverable error tailing pod logs, tearing down watcher")
+	if watcher, ok := watcherMap[streamErr.PodUID]; ok {
+		watcher.Stop()
+		delete(watcherMap, streamErr.PodUID)
+	}
+}
+
+// reconcileWatcherMap stops and removes any watcher in watcherMap whose pod
+// no longer matches labelSelector. It's needed because the podWatcher run()
+// swaps in on a selector change starts with an empty cache: its own relist
+// only diffs against what it has seen itself, so it never emits
+// DeletedPods() for pods that matched the old selector but not the new one.
+// Listing directly against the API is the only way to learn about those.
+func (pt *PodSetTailer) reconcileWatcherMap(labelSelector string, watcherMap map[types.UID]podLogSource) {
+	list, err := pt.kubeClient.Pods(pt.config.Namespace).List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		logrus.WithError(err).Warn("Error listing pods to reconcile watchers after selector change")
+		return
+	}
+	matching := make(map[types.UID]bool, len(list.Items))
+	for _, pod := range list.Items {
+		matching[pod.UID] = true
+	}
+	for uid, watcher := range watcherMap {
+		if matching[uid] {
+			continue
+		}
+		logrus.WithFields(logrus.Fields{
+			"uid": uid,
+		}).Info("pod no longer matches workload selector, stopping watcher")
+		watcher.Stop()
+		delete(watcherMap, uid)
+	}
+}
+
+// retryBackoff returns config.WatcherConfig.RetryBackoff if the user set
+// one, otherwise tailer.DefaultRetryBackoff.
+func (pt *PodSetTailer) retryBackoff() tailer.RetryBackoff {
+	if pt.config.RetryBackoff != nil {
+		return *pt.config.RetryBackoff
+	}
+	return tailer.DefaultRetryBackoff
+}
+
+// resolveLabelSelector turns the user's config into the selector string
+// passed to k8sagent.NewPodWatcher: either config.LabelSelector directly, or,
+// when config.Workload is set, the selector of the named Deployment,
+// StatefulSet, DaemonSet, or ReplicaSet. Either way, the agent's own pods
+// are always excluded.
+func (pt *PodSetTailer) resolveLabelSelector() (string, error) {
+	var labelSelector string
+	if pt.config.Workload != nil {
+		selector, err := resolveWorkloadSelector(pt.appsClient, pt.config.Namespace, pt.config.Workload)
+		if err != nil {
+			return "", err
+		}
+		labelSelector = selector
+	} else if pt.config.LabelSelector != nil {
+		labelSelector = *pt.config.LabelSelector
+	}
+
+	// Exclude the agent's own logs from being watched
+	if labelSelector == "" {
+		labelSelector = "k8s-app!=honeycomb-agent"
+	} else {
+		labelSelector = labelSelector + ",k8s-app!=honeycomb-agent"
+	}
+	return labelSelector, nil
+}
+
 func (pt *PodSetTailer) Start() {
 	pt.wg.Add(1)
 	go pt.run()
 }
 
 func (pt *PodSetTailer) Stop() {
+	// pt.stop and pt.workloadStop are two independent readers' signals, not
+	// one broadcast: run()'s main loop consumes the former,
+	// watchDeploymentSelector's goroutine the latter. Sharing a single
+	// chan bool between them meant whichever loop won the race on the one
+	// value sent would exit while the other blocked on it forever.
+	close(pt.workloadStop)
 	pt.stop <- true
 	pt.wg.Wait()
 }
@@ -175,19 +331,8 @@ func determineFilterFunc(pod *v1.Pod, containerName string, legacyLogPaths bool)
 	}
 }
 
-func (pt *PodSetTailer) watcherForPod(pod *v1.Pod, containerName string, podWatcher k8sagent.PodWatcher) (*tailer.PathWatcher, error) {
-	pattern, err := determineLogPattern(pod, pt.legacyLogPaths)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Pod": pod.UID,
-		}).Warn("Error finding log path")
-
-		// it's odd that we don't return here, should we?
-	}
-
-	// only watch logs for containers matching the given name, if
-	// one is specified
-	filterFunc := determineFilterFunc(pod, containerName, pt.legacyLogPaths)
+func (pt *PodSetTailer) watcherForPod(pod *v1.Pod, containerName string, podWatcher k8sagent.PodWatcher, streamErrors chan<- tailer.StreamError) (podLogSource, error) {
+	containerName = pt.resolveContainerName(pod, containerName)
 
 	k8sMetadataProcessor := &processors.KubernetesMetadataProcessor{
 		PodGetter: podWatcher,
@@ -204,12 +349,69 @@ func (pt *PodSetTailer) watcherForPod(pod *v1.Pod, containerName string, podWatc
 		return nil, err
 	}
 
+	if pt.config.LogSource == logSourceAPI {
+		return pt.apiLogSourceForPod(pod, containerName, handlerFactory), nil
+	}
+	return pt.fileLogSourceForPod(pod, containerName, handlerFactory, streamErrors)
+}
+
+// fileLogSourceForPod sets up a podLogSource backed by the log files
+// kubelet writes under /var/log. This is the original, default behavior,
+// and still what we use on clusters where the agent has the node's log
+// directory mounted. If the log path can't be resolved yet (e.g. a
+// critical pod's /var/log/pods/<hash> directory hasn't been created by
+// kubelet yet), it's handed off to a retryingFileLogSource instead of
+// being treated as a permanent failure.
+func (pt *PodSetTailer) fileLogSourceForPod(pod *v1.Pod, containerName string, handlerFactory handlers.LineHandlerFactory, streamErrors chan<- tailer.StreamError) (podLogSource, error) {
+	// only watch logs for containers matching the given name, if
+	// one is specified
+	filterFunc := determineFilterFunc(pod, containerName, pt.legacyLogPaths)
+	backoff := pt.retryBackoff()
+
+	pattern, err := determineLogPattern(pod, pt.legacyLogPaths)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Pod": pod.UID,
+		}).Warn("Error finding log path, will keep retrying")
+		return newRetryingFileLogSource(pod, pt.legacyLogPaths, containerName, filterFunc, handlerFactory, pt.stateRecorder, streamErrors, backoff), nil
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"Name":    pod.Name,
 		"UID":     pod.UID,
 		"Pattern": pattern,
 	}).Info("Setting up watcher for pod")
 
-	watcher := tailer.NewPathWatcher(pattern, filterFunc, handlerFactory, pt.stateRecorder)
+	watcher := tailer.NewPathWatcher(pattern, filterFunc, handlerFactory, pt.stateRecorder, pod.UID, containerName, streamErrors, backoff)
 	return watcher, nil
 }
+
+// apiLogSourceForPod sets up an apiPodLogSource, which streams container
+// logs straight from the API server. It's used when the node's /var/log
+// isn't reachable from the agent, e.g. GKE Autopilot or EKS Fargate.
+func (pt *PodSetTailer) apiLogSourceForPod(pod *v1.Pod, containerName string, handlerFactory handlers.LineHandlerFactory) *apiPodLogSource {
+	containers := containerNames(pod, containerName)
+
+	logrus.WithFields(logrus.Fields{
+		"Name":       pod.Name,
+		"UID":        pod.UID,
+		"Containers": containers,
+	}).Info("Setting up API log source for pod")
+
+	return newAPIPodLogSource(pod, containers, pt.kubeClient, handlerFactory, pt.stateRecorder)
+}
+
+// containerNames returns the set of container names apiLogSourceForPod
+// should stream. If containerName is non-empty only it is returned,
+// mirroring determineFilterFunc's behavior for the file tailer; otherwise
+// every container in the pod is streamed.
+func containerNames(pod *v1.Pod, containerName string) []string {
+	if containerName != "" {
+		return []string{containerName}
+	}
+	names := make([]string, 0, len(pod.Spec.Containers))
+	for _, c := range pod.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	return names
+}
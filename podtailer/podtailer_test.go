@@ -0,0 +1,61 @@
+package podtailer
+
+import (
+	"testing"
+
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/types"
+)
+
+func TestDetermineFilterFuncEmptyContainerNameMatchesEverything(t *testing.T) {
+	pod := &v1.Pod{}
+	pod.UID = types.UID("abc123")
+	if f := determineFilterFunc(pod, "", false); f != nil {
+		t.Fatal("determineFilterFunc with an empty containerName should return nil (no filtering)")
+	}
+}
+
+func TestDetermineFilterFuncMatchesOnlyNamedContainer(t *testing.T) {
+	pod := &v1.Pod{}
+	pod.UID = types.UID("abc123")
+
+	f := determineFilterFunc(pod, "app", false)
+	if f == nil {
+		t.Fatal("determineFilterFunc with a containerName should return a filter func")
+	}
+	if !f("/var/log/pods/abc123/app_0.log") {
+		t.Error("filter func should match the named container's log file")
+	}
+	if f("/var/log/pods/abc123/istio-proxy_0.log") {
+		t.Error("filter func should not match a different container's log file")
+	}
+}
+
+func TestDetermineFilterFuncLegacyLogPaths(t *testing.T) {
+	pod := &v1.Pod{}
+	pod.Name = "mypod"
+	pod.Namespace = "myns"
+
+	f := determineFilterFunc(pod, "app", true)
+	if f == nil {
+		t.Fatal("determineFilterFunc with a containerName should return a filter func")
+	}
+	if !f("/var/log/containers/mypod_myns_app-abcdef.log") {
+		t.Error("filter func should match the legacy log path for the named container")
+	}
+}
+
+func TestDetermineLogPatternLegacy(t *testing.T) {
+	pod := &v1.Pod{}
+	pod.Name = "mypod"
+	pod.Namespace = "myns"
+
+	pattern, err := determineLogPattern(pod, true)
+	if err != nil {
+		t.Fatalf("determineLogPattern returned error: %v", err)
+	}
+	want := "/var/log/containers/mypod_myns_*.log"
+	if pattern != want {
+		t.Errorf("determineLogPattern() = %q, want %q", pattern, want)
+	}
+}
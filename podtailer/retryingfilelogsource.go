@@ -0,0 +1,128 @@
+package podtailer
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/honeycombio/honeycomb-kubernetes-agent/handlers"
+	"github.com/honeycombio/honeycomb-kubernetes-agent/tailer"
+)
+
+// retryingFileLogSource covers the startup case where determineLogPattern
+// can't yet find a log directory for a pod — common for critical pods,
+// whose /var/log/pods/<hash> directory kubelet creates sometime after the
+// pod's Added event reaches us. It retries resolution with backoff and,
+// once a pattern resolves, hands off to a real tailer.PathWatcher for the
+// rest of the pod's life.
+type retryingFileLogSource struct {
+	pod            *v1.Pod
+	legacyLogPaths bool
+	containerName  string
+	filterFunc     func(fileName string) bool
+	handlerFactory handlers.LineHandlerFactory
+	stateRecorder  tailer.StateRecorder
+	errors         chan<- tailer.StreamError
+	backoff        tailer.RetryBackoff
+
+	mu      sync.Mutex
+	watcher *tailer.PathWatcher
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newRetryingFileLogSource(
+	pod *v1.Pod,
+	legacyLogPaths bool,
+	containerName string,
+	filterFunc func(fileName string) bool,
+	handlerFactory handlers.LineHandlerFactory,
+	stateRecorder tailer.StateRecorder,
+	errors chan<- tailer.StreamError,
+	backoff tailer.RetryBackoff,
+) *retryingFileLogSource {
+	return &retryingFileLogSource{
+		pod:            pod,
+		legacyLogPaths: legacyLogPaths,
+		containerName:  containerName,
+		filterFunc:     filterFunc,
+		handlerFactory: handlerFactory,
+		stateRecorder:  stateRecorder,
+		errors:         errors,
+		backoff:        backoff,
+		stop:           make(chan struct{}),
+	}
+}
+
+func (s *retryingFileLogSource) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+func (s *retryingFileLogSource) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watcher != nil {
+		s.watcher.Stop()
+	}
+}
+
+func (s *retryingFileLogSource) run() {
+	defer s.wg.Done()
+
+	backoff := s.backoff.Initial
+	for {
+		pattern, err := determineLogPattern(s.pod, s.legacyLogPaths)
+		if err != nil {
+			s.reportRecoverable(err)
+			if !s.sleepOrStop(backoff) {
+				return
+			}
+			backoff = s.backoff.Next(backoff)
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"Name":    s.pod.Name,
+			"UID":     s.pod.UID,
+			"Pattern": pattern,
+		}).Info("Log path resolved, starting watcher for pod")
+
+		watcher := tailer.NewPathWatcher(
+			pattern,
+			s.filterFunc,
+			s.handlerFactory,
+			s.stateRecorder,
+			s.pod.UID,
+			s.containerName,
+			s.errors,
+			s.backoff,
+		)
+		s.mu.Lock()
+		s.watcher = watcher
+		s.mu.Unlock()
+		watcher.Start()
+		return
+	}
+}
+
+func (s *retryingFileLogSource) reportRecoverable(err error) {
+	select {
+	case s.errors <- tailer.StreamError{Err: err, PodUID: s.pod.UID, ContainerName: s.containerName, Recoverable: true}:
+	case <-s.stop:
+	}
+}
+
+func (s *retryingFileLogSource) sleepOrStop(d time.Duration) bool {
+	select {
+	case <-s.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
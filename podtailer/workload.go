@@ -0,0 +1,129 @@
+package podtailer
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	appsv1types "k8s.io/client-go/pkg/apis/apps/v1"
+	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
+
+	"github.com/honeycombio/honeycomb-kubernetes-agent/config"
+)
+
+// workloadKindAliases maps the short forms users write in config (matching
+// kubectl's own shorthand) to the canonical Kind apps/v1 uses.
+var workloadKindAliases = map[string]string{
+	"deploy":      "Deployment",
+	"deployment":  "Deployment",
+	"sts":         "StatefulSet",
+	"statefulset": "StatefulSet",
+	"ds":          "DaemonSet",
+	"daemonset":   "DaemonSet",
+	"rs":          "ReplicaSet",
+	"replicaset":  "ReplicaSet",
+}
+
+// normalizeWorkloadKind canonicalizes the Kind in a config.Workload
+// (case-insensitively, accepting kubectl's short forms like "deploy" or
+// "sts") to the Kind the apps/v1 API actually uses.
+func normalizeWorkloadKind(kind string) (string, error) {
+	canonical, ok := workloadKindAliases[strings.ToLower(kind)]
+	if !ok {
+		return "", fmt.Errorf("unsupported workload kind %q: must be one of deployment, statefulset, daemonset, replicaset", kind)
+	}
+	return canonical, nil
+}
+
+// resolveWorkloadSelector looks up the workload named in config.Workload and
+// returns the string form of its pod template selector, ready to pass to
+// k8sagent.NewPodWatcher in place of config.LabelSelector.
+func resolveWorkloadSelector(appsClient appsv1.AppsV1Interface, namespace string, workload *config.Workload) (string, error) {
+	kind, err := normalizeWorkloadKind(workload.Kind)
+	if err != nil {
+		return "", err
+	}
+
+	var selector *metav1.LabelSelector
+	switch kind {
+	case "Deployment":
+		d, err := appsClient.Deployments(namespace).Get(workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("resolving Deployment %s/%s: %v", namespace, workload.Name, err)
+		}
+		selector = d.Spec.Selector
+	case "StatefulSet":
+		s, err := appsClient.StatefulSets(namespace).Get(workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("resolving StatefulSet %s/%s: %v", namespace, workload.Name, err)
+		}
+		selector = s.Spec.Selector
+	case "DaemonSet":
+		d, err := appsClient.DaemonSets(namespace).Get(workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("resolving DaemonSet %s/%s: %v", namespace, workload.Name, err)
+		}
+		selector = d.Spec.Selector
+	case "ReplicaSet":
+		r, err := appsClient.ReplicaSets(namespace).Get(workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("resolving ReplicaSet %s/%s: %v", namespace, workload.Name, err)
+		}
+		selector = r.Spec.Selector
+	}
+
+	asSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", fmt.Errorf("converting selector for %s %s/%s: %v", kind, namespace, workload.Name, err)
+	}
+	return asSelector.String(), nil
+}
+
+// watchDeploymentSelector re-resolves a Deployment's selector whenever the
+// Deployment object changes, and sends the (possibly unchanged) selector
+// string on updates. The pod template selector is immutable in practice,
+// but we still watch: it's the cheapest way to notice the Deployment
+// disappearing or being recreated, and guards against the rare case of a
+// selector actually changing underneath us. It runs until stop is closed or
+// the watch fails to start or ends, and closes the returned channel then.
+//
+// stop must be closed, not sent on: it's read by exactly one goroutine here,
+// but PodSetTailer.Stop also has its own independent run() loop to wake, and
+// a single chan bool value can only ever be delivered to one of them.
+func watchDeploymentSelector(appsClient appsv1.AppsV1Interface, namespace, name string, stop <-chan struct{}) <-chan string {
+	updates := make(chan string)
+	go func() {
+		defer close(updates)
+		w, err := appsClient.Deployments(namespace).Watch(metav1.ListOptions{
+			FieldSelector: "metadata.name=" + name,
+		})
+		if err != nil {
+			return
+		}
+		defer w.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case event, ok := <-w.ResultChan():
+				if !ok {
+					return
+				}
+				d, ok := event.Object.(*appsv1types.Deployment)
+				if !ok {
+					continue
+				}
+				selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+				if err != nil {
+					continue
+				}
+				select {
+				case updates <- selector.String():
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+	return updates
+}
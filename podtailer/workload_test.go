@@ -0,0 +1,36 @@
+package podtailer
+
+import "testing"
+
+func TestNormalizeWorkloadKind(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"deployment", "Deployment"},
+		{"Deployment", "Deployment"},
+		{"deploy", "Deployment"},
+		{"sts", "StatefulSet"},
+		{"statefulset", "StatefulSet"},
+		{"ds", "DaemonSet"},
+		{"daemonset", "DaemonSet"},
+		{"rs", "ReplicaSet"},
+		{"replicaset", "ReplicaSet"},
+	}
+	for _, c := range cases {
+		got, err := normalizeWorkloadKind(c.in)
+		if err != nil {
+			t.Errorf("normalizeWorkloadKind(%q) returned error: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("normalizeWorkloadKind(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestNormalizeWorkloadKindUnsupported(t *testing.T) {
+	if _, err := normalizeWorkloadKind("pod"); err == nil {
+		t.Fatal("normalizeWorkloadKind(\"pod\") returned no error, want one")
+	}
+}
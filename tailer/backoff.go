@@ -0,0 +1,39 @@
+package tailer
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryBackoff configures how long PathWatcher waits between attempts to
+// re-resolve a pod's log pattern after a recoverable error. It's set via
+// config.WatcherConfig.RetryBackoff; DefaultRetryBackoff is used when the
+// user doesn't configure one.
+type RetryBackoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// DefaultRetryBackoff matches podtailer's API log source backoff: start
+// quick, cap at 30s.
+var DefaultRetryBackoff = RetryBackoff{
+	Initial: 1 * time.Second,
+	Max:     30 * time.Second,
+}
+
+// Next doubles d, caps it at b.Max, and adds up to 20% jitter so many
+// watchers retrying at once don't all hammer the API/filesystem in lockstep.
+func (b RetryBackoff) Next(d time.Duration) time.Duration {
+	d *= 2
+	if d > b.Max {
+		d = b.Max
+	}
+	bound := int64(d) / 5
+	if bound <= 0 {
+		// rand.Int63n panics on n <= 0; a zero-valued RetryBackoff (retry
+		// immediately, no cap) would otherwise panic here.
+		return d
+	}
+	jitter := time.Duration(rand.Int63n(bound))
+	return d + jitter
+}
@@ -0,0 +1,34 @@
+package tailer
+
+import "testing"
+
+func TestRetryBackoffNextDoublesAndCaps(t *testing.T) {
+	b := RetryBackoff{Initial: 1, Max: 10}
+
+	next := b.Next(4)
+	if next < 8 {
+		t.Fatalf("Next(4) = %v, want at least the doubled value 8", next)
+	}
+
+	next = b.Next(6)
+	if next < b.Max {
+		t.Fatalf("Next(6) = %v, want at least b.Max (%v) once doubling exceeds it", next, b.Max)
+	}
+	if next > b.Max+b.Max/5 {
+		t.Fatalf("Next(6) = %v, want at most b.Max plus 20%% jitter (%v)", next, b.Max+b.Max/5)
+	}
+}
+
+func TestRetryBackoffNextZeroDurationDoesNotPanic(t *testing.T) {
+	b := RetryBackoff{Initial: 0, Max: 0}
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("Next(0) panicked: %v", r)
+		}
+	}()
+
+	if next := b.Next(0); next != 0 {
+		t.Fatalf("Next(0) = %v, want 0", next)
+	}
+}
@@ -0,0 +1,302 @@
+package tailer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/client-go/pkg/types"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/honeycombio/honeycomb-kubernetes-agent/handlers"
+)
+
+// pathWatcherPollInterval is how often PathWatcher re-globs its pattern
+// looking for new matches and new bytes appended to ones it already has
+// open.
+const pathWatcherPollInterval = 250 * time.Millisecond
+
+// PathWatcher tails the log file(s) matching a glob pattern (built by
+// podtailer.determineLogPattern/determineFilterFunc) and feeds each line
+// through a handlers.LineHandlerFactory. It's the file-based podLogSource;
+// podtailer.apiPodLogSource is the alternative that streams from the API
+// server instead.
+//
+// Problems it hits along the way are reported on errors as a StreamError,
+// classified Recoverable (rotation produced a short read, a matched file
+// briefly vanished) or not (none of podUID's files exist any more, because
+// the container or pod is gone) so the caller can decide whether to keep
+// retrying or tear the watcher down.
+type PathWatcher struct {
+	pattern        string
+	filterFunc     func(fileName string) bool
+	handlerFactory handlers.LineHandlerFactory
+	stateRecorder  StateRecorder
+	podUID         types.UID
+	containerName  string
+	errors         chan<- StreamError
+	backoff        RetryBackoff
+
+	stop chan struct{}
+}
+
+// NewPathWatcher constructs a PathWatcher. errors is a shared channel the
+// caller also hands to every other watcher it owns, so it can select over
+// all of them in one place (see podtailer.PodSetTailer.run).
+func NewPathWatcher(
+	pattern string,
+	filterFunc func(fileName string) bool,
+	handlerFactory handlers.LineHandlerFactory,
+	stateRecorder StateRecorder,
+	podUID types.UID,
+	containerName string,
+	errors chan<- StreamError,
+	backoff RetryBackoff,
+) *PathWatcher {
+	return &PathWatcher{
+		pattern:        pattern,
+		filterFunc:     filterFunc,
+		handlerFactory: handlerFactory,
+		stateRecorder:  stateRecorder,
+		podUID:         podUID,
+		containerName:  containerName,
+		errors:         errors,
+		backoff:        backoff,
+		stop:           make(chan struct{}),
+	}
+}
+
+func (w *PathWatcher) Start() {
+	go w.run()
+}
+
+func (w *PathWatcher) Stop() {
+	close(w.stop)
+}
+
+// run polls for files matching w.pattern and tails each one it finds. One
+// goroutine per matched path; run itself just keeps the matched set up to
+// date and stops when told to.
+func (w *PathWatcher) run() {
+	tailed := make(map[string]chan struct{})
+	tailDone := make(chan tailExit)
+	defer func() {
+		for _, stop := range tailed {
+			close(stop)
+		}
+	}()
+
+	backoff := w.backoff.Initial
+	ticker := time.NewTicker(pathWatcherPollInterval)
+	defer ticker.Stop()
+
+	// everMatched distinguishes "hasn't started yet" from "stopped for
+	// good": until we've successfully matched at least one file, an empty
+	// glob just means the log directory hasn't shown up yet (recoverable,
+	// keep retrying). Once we've had matches and the pattern stops
+	// matching anything at all, the container isn't writing logs there
+	// any more and isn't coming back, so that's terminal.
+	everMatched := false
+
+	for {
+		matches, err := filepath.Glob(w.pattern)
+		if err != nil {
+			matches = nil
+		}
+		matches = w.filterMatches(matches)
+
+		matchSet := make(map[string]bool, len(matches))
+		for _, path := range matches {
+			matchSet[path] = true
+		}
+		for path, stop := range tailed {
+			if !matchSet[path] {
+				close(stop)
+				delete(tailed, path)
+			}
+		}
+
+		if len(matches) == 0 {
+			if !everMatched {
+				w.reportError(fmt.Errorf("no log files matched %q", w.pattern), true)
+				if !w.sleepOrStop(backoff) {
+					return
+				}
+				backoff = w.backoff.Next(backoff)
+				continue
+			}
+			w.reportError(fmt.Errorf("%q stopped matching any files", w.pattern), false)
+			return
+		}
+		everMatched = true
+		backoff = w.backoff.Initial
+
+		for _, path := range matches {
+			if _, ok := tailed[path]; ok {
+				continue
+			}
+			stop := make(chan struct{})
+			tailed[path] = stop
+			go w.tailFile(path, stop, tailDone)
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case exit := <-tailDone:
+			// tailFile exited on its own (the file vanished, or couldn't
+			// be opened) rather than being told to via stop. Only drop the
+			// entry if it's still the one we started: if the path already
+			// got reassigned a fresh stop/goroutine since (e.g. the glob
+			// dropped and re-matched it between polls), this signal is
+			// stale and must not clobber it.
+			if tailed[exit.path] == exit.stop {
+				delete(tailed, exit.path)
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// tailExit is how tailFile tells run() it has exited on its own, so run()
+// can drop the corresponding tailed entry. path identifies which file, and
+// stop identifies which goroutine/generation of it — see the tailDone case
+// in run() for why that matters.
+type tailExit struct {
+	path string
+	stop chan struct{}
+}
+
+func (w *PathWatcher) filterMatches(matches []string) []string {
+	if w.filterFunc == nil {
+		return matches
+	}
+	var filtered []string
+	for _, m := range matches {
+		if w.filterFunc(m) {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
+
+// tailFile reads path from wherever stateRecorder says we left off,
+// handing each complete line to a fresh handler, and keeps polling for
+// appended bytes until stop is closed or the file disappears. In the latter
+// case it reports its exit on done so run() can drop its now-stale tailed
+// entry; run() itself already knows when it closes stop, so that path
+// doesn't need the signal.
+func (w *PathWatcher) tailFile(path string, stop chan struct{}, done chan<- tailExit) {
+	handler := w.handlerFactory.New()
+	offset := w.lastOffset(path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		w.reportError(fmt.Errorf("opening %s: %v", path, err), true)
+		w.reportExit(path, stop, done)
+		return
+	}
+	defer f.Close()
+
+	if offset > 0 {
+		if _, err := f.Seek(offset, os.SEEK_SET); err != nil {
+			offset = 0
+		}
+	}
+	reader := bufio.NewReader(f)
+
+	ticker := time.NewTicker(pathWatcherPollInterval)
+	defer ticker.Stop()
+
+	// pending holds a trailing partial line until the rest of it is written.
+	var pending string
+	for {
+		for {
+			line, err := reader.ReadString('\n')
+			if err == nil {
+				line = pending + line
+				pending = ""
+				offset += int64(len(line))
+				handler.Handle(line[:len(line)-1])
+				continue
+			}
+			pending += line
+			if err != io.EOF {
+				w.reportError(fmt.Errorf("reading %s: %v", path, err), true)
+			}
+			break
+		}
+		w.recordOffset(path, offset)
+
+		select {
+		case <-stop:
+			return
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if _, err := os.Stat(path); err != nil {
+				// The file is gone; treat this as recoverable if our
+				// pattern could still match a replacement (log rotation),
+				// non-recoverable once the whole pattern stops matching
+				// (checked back in run()).
+				w.reportError(fmt.Errorf("%s disappeared: %v", path, err), true)
+				w.reportExit(path, stop, done)
+				return
+			}
+		}
+	}
+}
+
+// reportExit tells run() this path's goroutine is gone so it can drop the
+// stale tailed entry, the same way reportError sends on w.errors: best
+// effort, abandoned if run() has already moved on to tearing the whole
+// watcher down.
+func (w *PathWatcher) reportExit(path string, stop chan struct{}, done chan<- tailExit) {
+	select {
+	case done <- tailExit{path: path, stop: stop}:
+	case <-w.stop:
+	}
+}
+
+func (w *PathWatcher) lastOffset(path string) int64 {
+	raw, err := w.stateRecorder.Get(path)
+	if err != nil || raw == "" {
+		return 0
+	}
+	var offset int64
+	if _, err := fmt.Sscanf(raw, "%d", &offset); err != nil {
+		return 0
+	}
+	return offset
+}
+
+func (w *PathWatcher) recordOffset(path string, offset int64) {
+	if err := w.stateRecorder.Record(path, fmt.Sprintf("%d", offset)); err != nil {
+		logrus.WithError(err).WithField("path", path).Warn("Error recording tailer state")
+	}
+}
+
+func (w *PathWatcher) reportError(err error, recoverable bool) {
+	streamErr := StreamError{
+		Err:           err,
+		PodUID:        w.podUID,
+		ContainerName: w.containerName,
+		Recoverable:   recoverable,
+	}
+	select {
+	case w.errors <- streamErr:
+	case <-w.stop:
+	}
+}
+
+func (w *PathWatcher) sleepOrStop(d time.Duration) bool {
+	select {
+	case <-w.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,10 @@
+package tailer
+
+// StateRecorder persists small bits of per-source state — a file's last
+// read offset, or an API log source's last-seen timestamp — keyed by an
+// arbitrary string the caller chooses, so the agent can resume after a
+// restart instead of rereading everything.
+type StateRecorder interface {
+	Record(key string, value string) error
+	Get(key string) (string, error)
+}
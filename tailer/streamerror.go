@@ -0,0 +1,21 @@
+package tailer
+
+import "k8s.io/client-go/pkg/types"
+
+// StreamError describes a problem a podLogSource hit while tailing a pod's
+// logs, and whether it's worth retrying. Recoverable errors are transient
+// conditions expected to clear up on their own, or with a fresh look at the
+// log location — the log directory not existing yet, a short read during
+// rotation — and the pod is still around, so the source should keep
+// trying. Non-recoverable errors mean there's nothing left to watch (the
+// pod or container is gone) and the watcher should be torn down.
+type StreamError struct {
+	Err           error
+	PodUID        types.UID
+	ContainerName string
+	Recoverable   bool
+}
+
+func (e StreamError) Error() string {
+	return e.Err.Error()
+}